@@ -0,0 +1,237 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-gitea/gitea/modules/git"
+	"github.com/go-gitea/gitea/modules/log"
+	"github.com/go-gitea/gitea/modules/setting"
+)
+
+// MigrateSSHConfig carries the key material needed to clone from an
+// authenticated SSH remote (git@host:owner/repo.git or ssh://...). The
+// private key is written to a temporary file for the duration of the clone
+// and scrubbed immediately afterwards; it is never persisted alongside the
+// repository.
+type MigrateSSHConfig struct {
+	PrivateKey  string
+	Passphrase  string
+	Fingerprint string // known_hosts line for the remote host
+}
+
+// sshWrapper materialises a disposable directory holding the private key and
+// a known_hosts file derived from Fingerprint, and returns a GIT_SSH_COMMAND
+// value that forces git to use only that key. The returned cleanup func must
+// be called once the clone is done to remove the key from disk.
+func (c *MigrateSSHConfig) sshWrapper() (command string, cleanup func(), err error) {
+	dir, err := ioutil.TempDir(filepath.Join(setting.AppDataPath, "tmp"), "migrate-ssh-")
+	if err != nil {
+		return "", nil, fmt.Errorf("TempDir: %v", err)
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Error(4, "RemoveAll(%s): %v", dir, err)
+		}
+	}
+
+	key := []byte(c.PrivateKey)
+	if len(c.Passphrase) > 0 {
+		if key, err = decryptPrivateKey(key, c.Passphrase); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("decrypt private key: %v", err)
+		}
+	}
+
+	keyPath := filepath.Join(dir, "id_migrate")
+	if err = ioutil.WriteFile(keyPath, key, 0600); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("write private key: %v", err)
+	}
+
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	if err = ioutil.WriteFile(knownHostsPath, []byte(c.Fingerprint+"\n"), 0600); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("write known_hosts: %v", err)
+	}
+
+	command = fmt.Sprintf("ssh -i %s -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes -o IdentitiesOnly=yes",
+		keyPath, knownHostsPath)
+	return command, cleanup, nil
+}
+
+// decryptPrivateKey decrypts a passphrase-protected PEM private key into a
+// throwaway unencrypted copy, since git's non-interactive clone has no way
+// to answer an SSH passphrase prompt.
+func decryptPrivateKey(pemBytes []byte, passphrase string) ([]byte, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM private key")
+	}
+	if !x509.IsEncryptedPEMBlock(block) {
+		return pemBytes, nil
+	}
+
+	der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("DecryptPEMBlock: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+}
+
+// MigrateOptions bundles the parameters needed to clone a repository into
+// Gitea, whether run synchronously or through the migration task queue.
+type MigrateOptions struct {
+	Owner     *User
+	Name      string
+	Desc      string
+	Private   bool
+	Mirror    bool
+	CloneAddr string
+	SSHConfig *MigrateSSHConfig
+
+	// Progress, if set, receives each line git writes to stderr during the
+	// clone (objects received, deltas resolved, percentage, ...).
+	Progress func(line string)
+	// Cancel, if set, is checked between clone phases; a closed channel
+	// aborts the migration with ErrMigrationCancelled.
+	Cancel <-chan struct{}
+}
+
+// ErrMigrationCancelled is returned by MigrateRepository when opts.Cancel is
+// closed before the clone completes.
+var ErrMigrationCancelled = fmt.Errorf("migration was cancelled")
+
+// MigrateRepository creates a new repository by cloning opts.CloneAddr. When
+// opts.SSHConfig is non-nil, the clone authenticates over SSH using the
+// supplied key instead of credentials embedded in the clone address.
+func MigrateRepository(opts MigrateOptions) (*Repository, error) {
+	repo, err := CreateRepository(opts.Owner, opts.Name, opts.Desc, "", "", opts.Private, opts.Mirror, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Cancel != nil {
+		select {
+		case <-opts.Cancel:
+			return repo, ErrMigrationCancelled
+		default:
+		}
+	}
+
+	var envs []string
+	if opts.SSHConfig != nil {
+		command, cleanup, err := opts.SSHConfig.sshWrapper()
+		if err != nil {
+			return repo, fmt.Errorf("sshWrapper: %v", err)
+		}
+		defer cleanup()
+		envs = append(envs, "GIT_SSH_COMMAND="+command)
+	}
+
+	repoPath := RepoPath(opts.Owner.Name, opts.Name)
+	cloneOpts := git.CloneRepoOptions{Mirror: opts.Mirror, Bare: true}
+
+	if opts.Progress == nil && opts.Cancel == nil {
+		if err = git.CloneWithEnv(opts.CloneAddr, repoPath, cloneOpts, envs); err != nil {
+			return repo, fmt.Errorf("Clone: %v", err)
+		}
+		return repo, nil
+	}
+
+	stderr, cmd, err := git.CloneWithProgressPipe(opts.CloneAddr, repoPath, cloneOpts, envs)
+	if err != nil {
+		return repo, fmt.Errorf("Clone: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		scanner.Split(bufio.ScanLines)
+		for scanner.Scan() {
+			if opts.Progress != nil {
+				opts.Progress(scanner.Text())
+			}
+		}
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			return repo, fmt.Errorf("Clone: %v", err)
+		}
+		return repo, nil
+	case <-opts.Cancel:
+		if err = cmd.Process.Kill(); err != nil {
+			log.Error(4, "kill migration clone: %v", err)
+		}
+		<-done
+		return repo, ErrMigrationCancelled
+	}
+}
+
+// migrationSemaphore bounds how many clones run at once, regardless of how
+// many migration tasks are queued.
+var migrationSemaphore = make(chan struct{}, setting.MigrationsMaxConcurrency)
+
+// EnqueueMigrationTask records a queued MigrationTask and starts a goroutine
+// that blocks on migrationSemaphore before running the clone, so it is safe
+// to call far more often than MigrationsMaxConcurrency.
+func EnqueueMigrationTask(doer *User, opts MigrateOptions) (*MigrationTask, error) {
+	task, err := CreateMigrationTask(doer.Id, opts.Owner.Id, opts.Name)
+	if err != nil {
+		return nil, fmt.Errorf("CreateMigrationTask: %v", err)
+	}
+
+	cancel := registerCancel(task.Id)
+	hub := migrationHub(task.Id)
+	opts.Cancel = cancel
+	opts.Progress = hub.Publish
+
+	go func() {
+		migrationSemaphore <- struct{}{}
+		defer func() { <-migrationSemaphore }()
+		defer finishTask(task.Id)
+
+		if err := task.updateStatus(MIGRATION_TASK_RUNNING, 0, nil); err != nil {
+			log.Error(4, "updateStatus(running): %v", err)
+		}
+
+		repo, err := MigrateRepository(opts)
+		status := MIGRATION_TASK_SUCCESS
+		switch err {
+		case nil:
+		case ErrMigrationCancelled:
+			status = MIGRATION_TASK_CANCELLED
+		default:
+			status = MIGRATION_TASK_FAILED
+		}
+
+		var repoId int64
+		if status == MIGRATION_TASK_SUCCESS {
+			repoId = repo.Id
+		} else if repo != nil {
+			// CreateRepository already inserted the repo row before the clone
+			// ran; since the clone didn't finish, there is no git data on disk
+			// for it, so leaving it behind would orphan it permanently.
+			if derr := DeleteRepository(opts.Owner.Id, repo.Id, opts.Owner.Name); derr != nil {
+				log.Error(4, "DeleteRepository(failed migration %d): %v", task.Id, derr)
+			}
+		}
+		if uerr := task.updateStatus(status, repoId, err); uerr != nil {
+			log.Error(4, "updateStatus(%v): %v", status, uerr)
+		}
+	}()
+
+	return task, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestDecryptPrivateKeyUnencrypted(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(priv),
+	})
+
+	out, err := decryptPrivateKey(pemBytes, "")
+	if err != nil {
+		t.Fatalf("decryptPrivateKey: %v", err)
+	}
+	if string(out) != string(pemBytes) {
+		t.Errorf("expected unencrypted key to pass through unchanged")
+	}
+}
+
+func TestDecryptPrivateKeyEncrypted(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	passphrase := "s3cr3t"
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY",
+		x509.MarshalPKCS1PrivateKey(priv), []byte(passphrase), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("EncryptPEMBlock: %v", err)
+	}
+	encrypted := pem.EncodeToMemory(block)
+
+	out, err := decryptPrivateKey(encrypted, passphrase)
+	if err != nil {
+		t.Fatalf("decryptPrivateKey: %v", err)
+	}
+
+	decoded, _ := pem.Decode(out)
+	if decoded == nil {
+		t.Fatalf("decryptPrivateKey returned invalid PEM")
+	}
+	if x509.IsEncryptedPEMBlock(decoded) {
+		t.Errorf("expected decrypted key to no longer be an encrypted PEM block")
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(decoded.Bytes); err != nil {
+		t.Errorf("decrypted key does not parse as PKCS1: %v", err)
+	}
+}
+
+func TestDecryptPrivateKeyInvalidPEM(t *testing.T) {
+	if _, err := decryptPrivateKey([]byte("not a key"), "whatever"); err == nil {
+		t.Errorf("expected error for invalid PEM input")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-gitea/gitea/modules/setting"
+)
+
+// MigrationCredential stores a private key a user has saved for
+// authenticating outbound mirror/migration clones over SSH.
+//
+// This is distinct from DeployKey: a DeployKey is a *public* key registered
+// so a remote client can authenticate inbound to this server. A
+// MigrationCredential is the opposite direction - this server is the client,
+// connecting out to somebody else's host - so it has to hold the private
+// half instead. Because it's a private key, PrivateKey is never stored in
+// the clear: it's AES-GCM encrypted with setting.SecretKey before insert and
+// decrypted on the way back out, so a raw DB dump or backup doesn't hand
+// over every saved credential's key.
+type MigrationCredential struct {
+	Id         int64
+	OwnerId    int64 `xorm:"INDEX"`
+	Name       string
+	PrivateKey string `xorm:"TEXT"` // encryptSecret output; see CreateMigrationCredential/GetMigrationCredentialById
+
+	Created time.Time `xorm:"created"`
+}
+
+// CreateMigrationCredential encrypts privateKey with setting.SecretKey and
+// inserts a new migration credential row owned by ownerId.
+func CreateMigrationCredential(ownerId int64, name, privateKey string) (*MigrationCredential, error) {
+	encrypted, err := encryptSecret(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryptSecret: %v", err)
+	}
+
+	cred := &MigrationCredential{
+		OwnerId:    ownerId,
+		Name:       name,
+		PrivateKey: encrypted,
+	}
+	if _, err = x.Insert(cred); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// GetMigrationCredentialById returns a migration credential by id, with
+// PrivateKey already decrypted. Callers must check ownerId against the
+// requesting user themselves; this function does not enforce access control.
+func GetMigrationCredentialById(id int64) (*MigrationCredential, error) {
+	cred := &MigrationCredential{Id: id}
+	has, err := x.Get(cred)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, fmt.Errorf("migration credential does not exist [id: %d]", id)
+	}
+
+	decrypted, err := decryptSecret(cred.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decryptSecret: %v", err)
+	}
+	cred.PrivateKey = decrypted
+	return cred, nil
+}
+
+// secretCipherKey derives a 32-byte AES-256 key from setting.SecretKey,
+// since the config value itself isn't guaranteed to be the right length.
+func secretCipherKey() []byte {
+	sum := sha256.Sum256([]byte(setting.SecretKey))
+	return sum[:]
+}
+
+// encryptSecret AES-GCM encrypts plaintext under secretCipherKey and returns
+// it as a base64 string suitable for storing in a TEXT column.
+func encryptSecret(plaintext string) (string, error) {
+	block, err := aes.NewCipher(secretCipherKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret reverses encryptSecret.
+func decryptSecret(encoded string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(secretCipherKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:nonceSize], sealed[nonceSize:]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
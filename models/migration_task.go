@@ -0,0 +1,210 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MigrationTaskStatus describes where an asynchronous migration is in its
+// lifecycle.
+type MigrationTaskStatus int
+
+const (
+	MIGRATION_TASK_QUEUED MigrationTaskStatus = iota
+	MIGRATION_TASK_RUNNING
+	MIGRATION_TASK_SUCCESS
+	MIGRATION_TASK_FAILED
+	MIGRATION_TASK_CANCELLED
+)
+
+// MigrationTask persists the state of a single MigrateRepository job so
+// clients can poll it across requests (and, since it is a DB row rather
+// than in-memory state, across restarts of the server).
+type MigrationTask struct {
+	Id       int64
+	DoerId   int64
+	OwnerId  int64
+	RepoName string
+	RepoId   int64 `xorm:"INDEX"`
+
+	Status MigrationTaskStatus `xorm:"NOT NULL DEFAULT 0"`
+	Error  string              `xorm:"TEXT"`
+
+	Created time.Time `xorm:"created"`
+	Updated time.Time `xorm:"updated"`
+}
+
+// CreateMigrationTask inserts a new queued migration task row.
+func CreateMigrationTask(doerId, ownerId int64, repoName string) (*MigrationTask, error) {
+	task := &MigrationTask{
+		DoerId:   doerId,
+		OwnerId:  ownerId,
+		RepoName: repoName,
+		Status:   MIGRATION_TASK_QUEUED,
+	}
+	_, err := x.Insert(task)
+	return task, err
+}
+
+// GetMigrationTaskById looks up a migration task by id.
+func GetMigrationTaskById(id int64) (*MigrationTask, error) {
+	task := &MigrationTask{Id: id}
+	has, err := x.Get(task)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, fmt.Errorf("migration task does not exist [id: %d]", id)
+	}
+	return task, nil
+}
+
+// updateStatus persists the task's status and, on failure, its error.
+func (task *MigrationTask) updateStatus(status MigrationTaskStatus, repoId int64, taskErr error) error {
+	task.Status = status
+	task.RepoId = repoId
+	if taskErr != nil {
+		task.Error = taskErr.Error()
+	}
+	_, err := x.Id(task.Id).Cols("status", "repo_id", "error").Update(task)
+	return err
+}
+
+// progressHub fans out the migration's git progress lines (objects
+// received, deltas resolved, percentage, ...) to any number of listeners,
+// e.g. the SSE handler backing GET /repos/migrate/:id/progress. Once the
+// migration finishes, Close marks the hub closed: every current listener's
+// channel is closed immediately, and any later Subscribe call returns an
+// already-closed channel instead of one nothing will ever publish to. This
+// is what lets a client that connects after the task finished still see its
+// "for range" loop end instead of block forever.
+type progressHub struct {
+	mu        sync.Mutex
+	listeners map[chan string]bool
+	closed    bool
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{listeners: make(map[chan string]bool)}
+}
+
+func (h *progressHub) Subscribe() chan string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan string, 16)
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.listeners[ch] = true
+	return ch
+}
+
+// Unsubscribe removes ch from the hub and closes it, unless the hub was
+// already closed (in which case Close already closed every listener).
+func (h *progressHub) Unsubscribe(ch chan string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.listeners[ch]; !ok {
+		return
+	}
+	delete(h.listeners, ch)
+	close(ch)
+}
+
+func (h *progressHub) Publish(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.listeners {
+		select {
+		case ch <- line:
+		default: // slow listener, drop the line rather than block the clone
+		}
+	}
+}
+
+// Close marks the hub finished, closing every current listener's channel.
+func (h *progressHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for ch := range h.listeners {
+		close(ch)
+	}
+	h.listeners = nil
+}
+
+var (
+	migrationHubsMu sync.Mutex
+	migrationHubs   = make(map[int64]*progressHub)
+	migrationCancel = make(map[int64]chan struct{})
+)
+
+func migrationHub(taskId int64) *progressHub {
+	migrationHubsMu.Lock()
+	defer migrationHubsMu.Unlock()
+	hub, ok := migrationHubs[taskId]
+	if !ok {
+		hub = newProgressHub()
+		migrationHubs[taskId] = hub
+	}
+	return hub
+}
+
+// SubscribeMigrationProgress returns a channel of progress lines for the
+// given task, along with an unsubscribe func to call once the caller (an
+// SSE handler) stops listening.
+func SubscribeMigrationProgress(taskId int64) (ch chan string, unsubscribe func()) {
+	hub := migrationHub(taskId)
+	ch = hub.Subscribe()
+	return ch, func() { hub.Unsubscribe(ch) }
+}
+
+// CancelMigrationTask signals a running migration to stop as soon as it
+// next checks for cancellation. It is safe to call more than once for the
+// same task: the cancel channel is removed from the registry and closed
+// under the same lock, so a second, racing call sees the task as already
+// gone rather than closing an already-closed channel.
+func CancelMigrationTask(taskId int64) error {
+	migrationHubsMu.Lock()
+	cancel, ok := migrationCancel[taskId]
+	if ok {
+		delete(migrationCancel, taskId)
+	}
+	migrationHubsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("migration task %d is not running", taskId)
+	}
+	close(cancel)
+	return nil
+}
+
+func registerCancel(taskId int64) chan struct{} {
+	cancel := make(chan struct{})
+	migrationHubsMu.Lock()
+	migrationCancel[taskId] = cancel
+	migrationHubsMu.Unlock()
+	return cancel
+}
+
+// finishTask closes the task's progress hub (ending any in-flight or future
+// SSE stream for it) and drops its cancellation channel, since cancelling an
+// already-finished migration makes no sense. The hub entry itself is kept
+// around so a client that connects after completion still gets a
+// (pre-closed) channel from Subscribe rather than a new one nothing will
+// ever close.
+func finishTask(taskId int64) {
+	migrationHub(taskId).Close()
+
+	migrationHubsMu.Lock()
+	delete(migrationCancel, taskId)
+	migrationHubsMu.Unlock()
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import "testing"
+
+func TestProgressHubPublishSubscribe(t *testing.T) {
+	hub := newProgressHub()
+	ch := hub.Subscribe()
+
+	hub.Publish("cloning into repo...")
+	if got := <-ch; got != "cloning into repo..." {
+		t.Errorf("got %q, want %q", got, "cloning into repo...")
+	}
+}
+
+func TestProgressHubUnsubscribeClosesChannel(t *testing.T) {
+	hub := newProgressHub()
+	ch := hub.Subscribe()
+
+	unsubscribe := func() { hub.Unsubscribe(ch) }
+	unsubscribe()
+
+	if _, ok := <-ch; ok {
+		t.Errorf("expected channel to be closed after Unsubscribe")
+	}
+
+	// A second Unsubscribe of the same channel must not panic (double close).
+	unsubscribe()
+}
+
+func TestProgressHubCloseClosesListeners(t *testing.T) {
+	hub := newProgressHub()
+	ch := hub.Subscribe()
+
+	hub.Close()
+
+	if _, ok := <-ch; ok {
+		t.Errorf("expected channel to be closed after Close")
+	}
+}
+
+func TestProgressHubSubscribeAfterCloseReturnsClosedChannel(t *testing.T) {
+	hub := newProgressHub()
+	hub.Close()
+
+	ch := hub.Subscribe()
+	if _, ok := <-ch; ok {
+		t.Errorf("expected late Subscribe after Close to return an already-closed channel")
+	}
+}
+
+func TestProgressHubCloseIsIdempotent(t *testing.T) {
+	hub := newProgressHub()
+	hub.Subscribe()
+
+	hub.Close()
+	hub.Close() // must not panic closing an already-closed hub
+}
+
+func TestCancelMigrationTaskIsIdempotent(t *testing.T) {
+	const taskId = int64(12345)
+	registerCancel(taskId)
+	defer func() {
+		migrationHubsMu.Lock()
+		delete(migrationCancel, taskId)
+		migrationHubsMu.Unlock()
+	}()
+
+	if err := CancelMigrationTask(taskId); err != nil {
+		t.Fatalf("CancelMigrationTask: %v", err)
+	}
+
+	// A second, racing cancel of the same task must not panic closing an
+	// already-closed channel; it should simply report the task as gone.
+	if err := CancelMigrationTask(taskId); err == nil {
+		t.Errorf("expected error cancelling an already-cancelled task")
+	}
+}
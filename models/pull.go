@@ -0,0 +1,387 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Unknwon/com"
+
+	"github.com/go-gitea/gitea/modules/git"
+	"github.com/go-gitea/gitea/modules/setting"
+)
+
+// PullRequestStatus defines whether a pull request can be merged automatically.
+type PullRequestStatus int
+
+const (
+	PULL_REQUEST_STATUS_CHECKING PullRequestStatus = iota
+	PULL_REQUEST_STATUS_MERGEABLE
+	PULL_REQUEST_STATUS_CONFLICT
+)
+
+// MergeStyle represents the approach used to merge a pull request into its base branch.
+type MergeStyle string
+
+const (
+	MERGE_STYLE_MERGE  MergeStyle = "merge"
+	MERGE_STYLE_REBASE MergeStyle = "rebase"
+	MERGE_STYLE_SQUASH MergeStyle = "squash"
+)
+
+// PullRequest represents relation between an issue and a pull request of a repository.
+type PullRequest struct {
+	Id      int64
+	Issue   *Issue `xorm:"-"`
+	IssueId int64
+
+	HeadRepoId int64
+	HeadRepo   *Repository `xorm:"-"`
+	HeadBranch string
+	BaseRepoId int64
+	BaseRepo   *Repository `xorm:"-"`
+	BaseBranch string
+
+	MergeBase string `xorm:"VARCHAR(40)"`
+
+	HasMerged      bool
+	MergedCommitId string `xorm:"VARCHAR(40)"`
+	MergerId       int64
+	Merger         *User `xorm:"-"`
+
+	Status PullRequestStatus `xorm:"NOT NULL DEFAULT 0"`
+}
+
+// Merged returns whether this pull request has already been merged.
+func (pr *PullRequest) Merged() bool {
+	return pr.HasMerged
+}
+
+// GetHeadRepo populates pr.HeadRepo.
+func (pr *PullRequest) GetHeadRepo() (err error) {
+	if pr.HeadRepo != nil {
+		return nil
+	}
+	pr.HeadRepo, err = GetRepositoryById(pr.HeadRepoId)
+	return err
+}
+
+// GetBaseRepo populates pr.BaseRepo.
+func (pr *PullRequest) GetBaseRepo() (err error) {
+	if pr.BaseRepo != nil {
+		return nil
+	}
+	pr.BaseRepo, err = GetRepositoryById(pr.BaseRepoId)
+	return err
+}
+
+// ErrPullRequestNotExist represents a "PullRequestNotExist" kind of error.
+type ErrPullRequestNotExist struct {
+	Id      int64
+	IssueId int64
+	RepoId  int64
+}
+
+func (err ErrPullRequestNotExist) Error() string {
+	return fmt.Sprintf("pull request does not exist [id: %d, issue_id: %d, repo_id: %d]",
+		err.Id, err.IssueId, err.RepoId)
+}
+
+// IsErrPullRequestNotExist returns whether err is an ErrPullRequestNotExist.
+func IsErrPullRequestNotExist(err error) bool {
+	_, ok := err.(ErrPullRequestNotExist)
+	return ok
+}
+
+// splitCompareSpec splits a compare spec of the form "owner:branch" into its
+// owner and branch parts. A spec with no ":" is treated as a bare branch
+// name, returning an empty owner.
+func splitCompareSpec(spec string) (ownerName, branch string) {
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return "", spec
+}
+
+// ResolveCompareHead resolves a compare spec into the concrete head
+// repository and branch for a pull request against baseRepo. A bare branch
+// name ("my-feature") refers to a branch on baseRepo itself; an
+// "owner:branch" spec ("alice:my-feature") refers to a branch on owner's
+// fork of baseRepo, which is how a pull request is raised from a fork back
+// to the repository it was forked from.
+func ResolveCompareHead(baseRepo *Repository, spec string) (headRepo *Repository, headBranch string, err error) {
+	ownerName, branch := splitCompareSpec(spec)
+	if len(ownerName) == 0 {
+		return baseRepo, branch, nil
+	}
+
+	owner, err := GetUserByName(ownerName)
+	if err != nil {
+		return nil, "", fmt.Errorf("GetUserByName(%s): %v", ownerName, err)
+	}
+	if owner.Id == baseRepo.OwnerId {
+		return baseRepo, branch, nil
+	}
+
+	headRepo, err = GetRepositoryByName(owner.Id, baseRepo.Name)
+	if err != nil {
+		return nil, "", fmt.Errorf("GetRepositoryByName(%s/%s): %v", ownerName, baseRepo.Name, err)
+	}
+	if !headRepo.IsFork || headRepo.ForkId != baseRepo.Id {
+		return nil, "", fmt.Errorf("%s/%s is not a fork of this repository", ownerName, baseRepo.Name)
+	}
+	return headRepo, branch, nil
+}
+
+// NewPullRequest creates the issue and pull request rows for a new pull
+// request in a single transaction so the two tables never go out of sync.
+func NewPullRequest(repo *Repository, pull *Issue, labelIds []int64, uuids []string, pr *PullRequest) (err error) {
+	sess := x.NewSession()
+	defer sessionRelease(sess)
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+
+	if err = newIssue(sess, repo, pull, labelIds, uuids, true); err != nil {
+		return fmt.Errorf("newIssue: %v", err)
+	}
+
+	pr.IssueId = pull.Id
+	pr.Status = PULL_REQUEST_STATUS_CHECKING
+	if _, err = sess.Insert(pr); err != nil {
+		return fmt.Errorf("insert pull request: %v", err)
+	}
+
+	return sess.Commit()
+}
+
+// GetPullRequestByIndex returns a pull request by the repository it belongs
+// to and its issue index.
+func GetPullRequestByIndex(repoId, index int64) (*PullRequest, error) {
+	issue, err := GetIssueByIndex(repoId, index)
+	if err != nil {
+		return nil, err
+	}
+	if !issue.IsPull {
+		return nil, ErrPullRequestNotExist{0, issue.Id, repoId}
+	}
+
+	pr := &PullRequest{IssueId: issue.Id}
+	has, err := x.Get(pr)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ErrPullRequestNotExist{0, issue.Id, repoId}
+	}
+	pr.Issue = issue
+	return pr, nil
+}
+
+// PullRequestsOptions holds the filter/sort parameters accepted by PullRequests.
+type PullRequestsOptions struct {
+	Page     int
+	State    string // "open", "closed" or "all"
+	SortType string // "newest", "oldest", "recentupdate", "mostcomment"
+}
+
+// PullRequests returns pull requests for a repository filtered and sorted
+// according to opts, along with the total count for pagination.
+func PullRequests(repoId int64, opts *PullRequestsOptions) ([]*PullRequest, int64, error) {
+	if opts.Page <= 0 {
+		opts.Page = 1
+	}
+
+	sess := x.Join("INNER", "issue", "issue.id = pull_request.issue_id").
+		Where("issue.repo_id=?", repoId).And("issue.is_pull=?", true)
+	switch opts.State {
+	case "closed":
+		sess = sess.And("issue.is_closed=?", true)
+	case "open":
+		sess = sess.And("issue.is_closed=?", false)
+	}
+
+	count, err := sess.Clone().Count(new(PullRequest))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Count: %v", err)
+	}
+
+	switch opts.SortType {
+	case "oldest":
+		sess = sess.Asc("issue.created")
+	case "recentupdate":
+		sess = sess.Desc("issue.updated")
+	case "mostcomment":
+		sess = sess.Desc("issue.num_comments")
+	default: // "newest"
+		sess = sess.Desc("issue.created")
+	}
+
+	prs := make([]*PullRequest, 0, setting.IssuePagingNum)
+	if err = sess.Limit(setting.IssuePagingNum, (opts.Page-1)*setting.IssuePagingNum).Find(&prs); err != nil {
+		return nil, 0, fmt.Errorf("Find: %v", err)
+	}
+
+	for _, pr := range prs {
+		if err = pr.GetHeadRepo(); err != nil {
+			return nil, 0, fmt.Errorf("GetHeadRepo: %v", err)
+		}
+		if err = pr.GetBaseRepo(); err != nil {
+			return nil, 0, fmt.Errorf("GetBaseRepo: %v", err)
+		}
+	}
+	return prs, count, nil
+}
+
+// patchPath returns the scratch work tree used to compute mergeability and
+// perform merges for this pull request, keyed by id so concurrent requests
+// don't collide.
+func (pr *PullRequest) patchPath() string {
+	return filepath.Join(setting.AppDataPath, "tmp", "pulls", com.ToStr(pr.Id))
+}
+
+// testPatch checks out the base and head branches into a disposable work
+// tree to determine whether they can be merged without conflicts, and
+// persists the result to pr.Status.
+func (pr *PullRequest) testPatch() error {
+	if err := pr.GetBaseRepo(); err != nil {
+		return fmt.Errorf("GetBaseRepo: %v", err)
+	}
+	if err := pr.GetHeadRepo(); err != nil {
+		return fmt.Errorf("GetHeadRepo: %v", err)
+	}
+
+	patchPath := pr.patchPath()
+	if err := os.RemoveAll(patchPath); err != nil {
+		return fmt.Errorf("RemoveAll: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(patchPath), os.ModePerm); err != nil {
+		return fmt.Errorf("MkdirAll: %v", err)
+	}
+
+	if err := git.Clone(pr.BaseRepo.RepoPath(), patchPath, git.CloneRepoOptions{Branch: pr.BaseBranch}); err != nil {
+		return fmt.Errorf("git clone: %v", err)
+	}
+
+	remoteName := "head_" + com.ToStr(pr.Id)
+	if err := git.NewCommand("remote", "add", remoteName, pr.HeadRepo.RepoPath()).RunInDir(patchPath); err != nil {
+		return fmt.Errorf("git remote add: %v", err)
+	}
+	if err := git.NewCommand("fetch", remoteName, pr.HeadBranch).RunInDir(patchPath); err != nil {
+		return fmt.Errorf("git fetch: %v", err)
+	}
+
+	if err := git.NewCommand("merge-tree", "--write-tree", "HEAD", "FETCH_HEAD").RunInDir(patchPath); err != nil {
+		pr.Status = PULL_REQUEST_STATUS_CONFLICT
+	} else {
+		pr.Status = PULL_REQUEST_STATUS_MERGEABLE
+	}
+
+	_, err := x.Id(pr.Id).Cols("status").Update(pr)
+	return err
+}
+
+// ensureIssueRepo populates pr.Issue.Repo from pr.BaseRepo when it hasn't
+// already been set. Callers reach pr.Issue via GetPullRequestByIndex (which
+// only calls GetIssueByIndex) or a similarly narrow lookup, so it never
+// carries its Repo; changeStatus needs it, so Merge must backfill it itself
+// rather than rely on every caller remembering to.
+func (pr *PullRequest) ensureIssueRepo() {
+	if pr.Issue.Repo == nil {
+		pr.Issue.Repo = pr.BaseRepo
+	}
+}
+
+// ClosePullRequest closes the pull request's issue without merging it. It is
+// a no-op error for a pull request that has already been merged, since that
+// already implies closed.
+func (pr *PullRequest) ClosePullRequest(doer *User) (err error) {
+	if pr.HasMerged {
+		return fmt.Errorf("pull request #%d is already merged", pr.Id)
+	}
+
+	sess := x.NewSession()
+	defer sessionRelease(sess)
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+
+	pr.ensureIssueRepo()
+	if err = pr.Issue.changeStatus(sess, doer, pr.Issue.Repo, true); err != nil {
+		return fmt.Errorf("changeStatus: %v", err)
+	}
+
+	return sess.Commit()
+}
+
+// Merge merges the pull request into its base branch using the given style,
+// marks the underlying issue as closed and merged, and cleans up the scratch
+// work tree.
+func (pr *PullRequest) Merge(doer *User, style MergeStyle) (err error) {
+	if pr.HasMerged {
+		return fmt.Errorf("pull request #%d is already merged", pr.Id)
+	}
+
+	if err = pr.testPatch(); err != nil {
+		return fmt.Errorf("testPatch: %v", err)
+	}
+	if pr.Status != PULL_REQUEST_STATUS_MERGEABLE {
+		return fmt.Errorf("pull request #%d is not mergeable", pr.Id)
+	}
+
+	patchPath := pr.patchPath()
+	defer os.RemoveAll(patchPath)
+
+	message := fmt.Sprintf("Merge pull request #%d from %s/%s", pr.Issue.Index,
+		strings.TrimSuffix(pr.HeadRepo.Name, ".git"), pr.HeadBranch)
+
+	switch style {
+	case MERGE_STYLE_REBASE:
+		if err = git.NewCommand("rebase", "FETCH_HEAD").RunInDir(patchPath); err != nil {
+			return fmt.Errorf("git rebase: %v", err)
+		}
+	case MERGE_STYLE_SQUASH:
+		if err = git.NewCommand("merge", "--squash", "FETCH_HEAD").RunInDir(patchPath); err != nil {
+			return fmt.Errorf("git merge --squash: %v", err)
+		}
+		if err = git.NewCommand("commit", "-m", message).RunInDir(patchPath); err != nil {
+			return fmt.Errorf("git commit: %v", err)
+		}
+	default: // MERGE_STYLE_MERGE
+		if err = git.NewCommand("merge", "--no-ff", "-m", message, "FETCH_HEAD").RunInDir(patchPath); err != nil {
+			return fmt.Errorf("git merge: %v", err)
+		}
+	}
+
+	headCommit, err := git.NewCommand("rev-parse", "HEAD").RunInDirBytes(patchPath)
+	if err != nil {
+		return fmt.Errorf("rev-parse HEAD: %v", err)
+	}
+	if err = git.Push(patchPath, "origin", pr.BaseBranch); err != nil {
+		return fmt.Errorf("git push: %v", err)
+	}
+
+	sess := x.NewSession()
+	defer sessionRelease(sess)
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+
+	pr.HasMerged = true
+	pr.MergedCommitId = strings.TrimSpace(string(headCommit))
+	pr.MergerId = doer.Id
+	if _, err = sess.Id(pr.Id).AllCols().Update(pr); err != nil {
+		return fmt.Errorf("update pull request: %v", err)
+	}
+
+	pr.ensureIssueRepo()
+	if err = pr.Issue.changeStatus(sess, doer, pr.Issue.Repo, true); err != nil {
+		return fmt.Errorf("changeStatus: %v", err)
+	}
+
+	return sess.Commit()
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import "testing"
+
+func TestSplitCompareSpec(t *testing.T) {
+	cases := []struct {
+		spec       string
+		wantOwner  string
+		wantBranch string
+	}{
+		{"my-feature", "", "my-feature"},
+		{"alice:my-feature", "alice", "my-feature"},
+		{"alice:feature/with-slash", "alice", "feature/with-slash"},
+		{":leading-colon", "", "leading-colon"},
+	}
+
+	for _, c := range cases {
+		owner, branch := splitCompareSpec(c.spec)
+		if owner != c.wantOwner || branch != c.wantBranch {
+			t.Errorf("splitCompareSpec(%q) = (%q, %q), want (%q, %q)",
+				c.spec, owner, branch, c.wantOwner, c.wantBranch)
+		}
+	}
+}
+
+func TestEnsureIssueRepoBackfillsFromBaseRepo(t *testing.T) {
+	baseRepo := &Repository{Id: 1, Name: "base"}
+	pr := &PullRequest{
+		Issue:    &Issue{},
+		BaseRepo: baseRepo,
+	}
+
+	pr.ensureIssueRepo()
+
+	if pr.Issue.Repo != baseRepo {
+		t.Errorf("ensureIssueRepo did not backfill pr.Issue.Repo from pr.BaseRepo")
+	}
+}
+
+func TestEnsureIssueRepoLeavesExistingRepo(t *testing.T) {
+	already := &Repository{Id: 2, Name: "already-set"}
+	pr := &PullRequest{
+		Issue:    &Issue{Repo: already},
+		BaseRepo: &Repository{Id: 1, Name: "base"},
+	}
+
+	pr.ensureIssueRepo()
+
+	if pr.Issue.Repo != already {
+		t.Errorf("ensureIssueRepo overwrote an already-populated pr.Issue.Repo")
+	}
+}
+
+func TestClosePullRequestRejectsAlreadyMerged(t *testing.T) {
+	pr := &PullRequest{HasMerged: true}
+
+	if err := pr.ClosePullRequest(&User{Id: 1}); err == nil {
+		t.Errorf("expected error closing an already-merged pull request")
+	}
+}
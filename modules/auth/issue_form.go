@@ -0,0 +1,31 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/go-macaron/binding"
+	"gopkg.in/macaron.v1"
+)
+
+// CreateIssueForm is used both for plain issues and, when BaseBranch/
+// HeadBranch are set, for pull requests opened against the same repository
+// via CompareAndPullRequestPost.
+type CreateIssueForm struct {
+	IssueName   string `binding:"Required;MaxSize(255)"`
+	MilestoneId int64
+	AssigneeId  int64
+	LabelIds    string `form:"label_ids"`
+	Content     string
+
+	// BaseBranch is always a branch on the current repository. HeadBranch
+	// is either a bare branch name on the current repository, or
+	// "owner:branch" naming a branch on owner's fork of it.
+	BaseBranch string
+	HeadBranch string
+}
+
+func (f *CreateIssueForm) Validate(ctx *macaron.Context, errs binding.Errors) binding.Errors {
+	return validate(errs, ctx.Data, f, ctx.Locale)
+}
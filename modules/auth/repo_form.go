@@ -0,0 +1,48 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/go-macaron/binding"
+	"gopkg.in/macaron.v1"
+)
+
+// MigrateRepoForm is the form used when migrating (optionally mirroring) an
+// existing repository into Gitea.
+type MigrateRepoForm struct {
+	CloneAddr    string `json:"clone_addr" binding:"Required"`
+	AuthUsername string `json:"auth_username"`
+	AuthPassword string `json:"auth_password"`
+
+	// AuthSSHPrivateKey holds a PEM-encoded private key to use when CloneAddr
+	// is an SSH remote (git@host:owner/repo.git or ssh://...). It is mutually
+	// exclusive with AuthUsername/AuthPassword and with AuthSSHKeyId.
+	AuthSSHPrivateKey  string `json:"auth_ssh_private_key"`
+	AuthSSHPassphrase  string `json:"auth_ssh_passphrase"`
+	AuthSSHFingerprint string `json:"auth_ssh_fingerprint"`
+
+	// AuthSSHKeyId references a previously stored models.MigrationCredential
+	// to use instead of an inline private key. This is NOT a DeployKey:
+	// deploy keys are public keys that grant inbound access to this server,
+	// the opposite of what an outbound mirror clone needs.
+	AuthSSHKeyId int64 `json:"auth_ssh_key_id"`
+
+	Uid         int64  `json:"uid" binding:"Required"`
+	RepoName    string `json:"repo_name" binding:"Required;AlphaDashDot;MaxSize(100)"`
+	Mirror      bool   `json:"mirror"`
+	Private     bool   `json:"private"`
+	Description string `json:"description" binding:"MaxSize(255)"`
+}
+
+// UsesSSHAuth reports whether this form supplies SSH key material (either an
+// inline private key or a reference to a stored migration credential) rather
+// than HTTP(S) basic auth.
+func (f MigrateRepoForm) UsesSSHAuth() bool {
+	return len(f.AuthSSHPrivateKey) > 0 || f.AuthSSHKeyId > 0
+}
+
+func (f *MigrateRepoForm) Validate(ctx *macaron.Context, errs binding.Errors) binding.Errors {
+	return validate(errs, ctx.Data, f, ctx.Locale)
+}
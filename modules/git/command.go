@@ -0,0 +1,134 @@
+// Copyright 2015 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package git wraps invocations of the git binary needed by the migration
+// and pull request merge code paths: plain/mirror clones (optionally
+// authenticated over SSH via a caller-supplied environment), streaming the
+// clone's progress output, running arbitrary git subcommands against a work
+// tree, and pushing a branch back to a remote.
+package git
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Command represents a single git invocation, built up via NewCommand and
+// run against a work tree with RunInDir/RunInDirBytes.
+type Command struct {
+	args []string
+}
+
+// NewCommand returns a Command that will invoke "git" with the given
+// arguments.
+func NewCommand(args ...string) *Command {
+	return &Command{args: args}
+}
+
+func (c *Command) cmd(dir string) *exec.Cmd {
+	cmd := exec.Command("git", c.args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// RunInDir runs the command in dir, returning an error including captured
+// stderr if it exits non-zero.
+func (c *Command) RunInDir(dir string) error {
+	_, err := c.RunInDirBytes(dir)
+	return err
+}
+
+// RunInDirBytes runs the command in dir and returns its stdout.
+func (c *Command) RunInDirBytes(dir string) ([]byte, error) {
+	cmd := c.cmd(dir)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &Error{args: c.args, stderr: stderr.String(), err: err}
+	}
+	return stdout.Bytes(), nil
+}
+
+// Error wraps a failed git invocation with the captured stderr so callers
+// get an actionable message instead of a bare exit status.
+type Error struct {
+	args   []string
+	stderr string
+	err    error
+}
+
+func (e *Error) Error() string {
+	if len(e.stderr) == 0 {
+		return e.err.Error()
+	}
+	return e.err.Error() + ": " + e.stderr
+}
+
+// CloneRepoOptions configures Clone/CloneWithEnv/CloneWithProgressPipe.
+type CloneRepoOptions struct {
+	Mirror bool
+	Bare   bool
+	Branch string
+}
+
+func (o CloneRepoOptions) args(url, dest string) []string {
+	args := []string{"clone"}
+	if o.Mirror {
+		args = append(args, "--mirror")
+	}
+	if o.Bare {
+		args = append(args, "--bare")
+	}
+	if len(o.Branch) > 0 {
+		args = append(args, "-b", o.Branch)
+	}
+	return append(args, url, dest)
+}
+
+// Clone clones url into dest using the calling process's environment.
+func Clone(url, dest string, opts CloneRepoOptions) error {
+	return CloneWithEnv(url, dest, opts, nil)
+}
+
+// CloneWithEnv clones url into dest, appending envs (e.g.
+// "GIT_SSH_COMMAND=...") to the subprocess's environment so callers can
+// authenticate the clone without touching the URL itself.
+func CloneWithEnv(url, dest string, opts CloneRepoOptions, envs []string) error {
+	cmd := exec.Command("git", opts.args(url, dest)...)
+	cmd.Env = append(os.Environ(), envs...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return &Error{args: cmd.Args, stderr: stderr.String(), err: err}
+	}
+	return nil
+}
+
+// CloneWithProgressPipe starts a clone of url into dest and returns a pipe
+// of the subprocess's stderr (where git writes its "Receiving objects"/
+// "Resolving deltas" progress) along with the running *exec.Cmd. The caller
+// must read stderr to EOF and then call cmd.Wait to reap the process; this
+// mirrors exec.Cmd.StderrPipe's contract.
+func CloneWithProgressPipe(url, dest string, opts CloneRepoOptions, envs []string) (io.ReadCloser, *exec.Cmd, error) {
+	args := append(opts.args(url, dest), "--progress")
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), envs...)
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return stderr, cmd, nil
+}
+
+// Push pushes branch to remote from the work tree at repoPath.
+func Push(repoPath, remote, branch string) error {
+	return NewCommand("push", remote, branch).RunInDir(repoPath)
+}
@@ -0,0 +1,10 @@
+// Copyright 2015 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package setting
+
+// MigrationsMaxConcurrency caps how many repository migrations may run at
+// once, regardless of how many are queued. Configured via the
+// MAX_CONCURRENCY key of the [migrations] section in app.ini.
+var MigrationsMaxConcurrency = 3
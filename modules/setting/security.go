@@ -0,0 +1,11 @@
+// Copyright 2015 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package setting
+
+// SecretKey is the server-wide key used to encrypt sensitive values at rest
+// (e.g. saved migration credentials' private keys). Configured via the
+// SECRET_KEY key of the [security] section in app.ini; the default below is
+// only appropriate for development.
+var SecretKey = "!#@FDEWREWR&*("
@@ -0,0 +1,125 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package v1
+
+import (
+	"fmt"
+
+	"github.com/go-gitea/gitea/models"
+	"github.com/go-gitea/gitea/modules/base"
+	"github.com/go-gitea/gitea/modules/middleware"
+)
+
+func migrationTaskStatusString(status models.MigrationTaskStatus) string {
+	switch status {
+	case models.MIGRATION_TASK_QUEUED:
+		return "queued"
+	case models.MIGRATION_TASK_RUNNING:
+		return "running"
+	case models.MIGRATION_TASK_SUCCESS:
+		return "success"
+	case models.MIGRATION_TASK_FAILED:
+		return "failed"
+	case models.MIGRATION_TASK_CANCELLED:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// canAccessMigrationTask reports whether ctx.User may view or control task,
+// i.e. is the user who kicked it off. Without this check, any authenticated
+// caller could poll, stream, or cancel another user's migration just by
+// guessing its numeric id, and a failed task's Error (which can contain git
+// stderr, filesystem paths, or SSH diagnostics) would leak to them via
+// GetMigrateStatus.
+func canAccessMigrationTask(ctx *middleware.Context, task *models.MigrationTask) bool {
+	return ctx.User.IsAdmin || ctx.User.Id == task.DoerId
+}
+
+// GetMigrateStatus serves GET /repos/migrate/:id and reports the current
+// state of a previously-queued migration task.
+func GetMigrateStatus(ctx *middleware.Context) {
+	task, err := models.GetMigrationTaskById(ctx.ParamsInt64(":id"))
+	if err != nil {
+		ctx.JSON(404, &base.ApiJsonErr{err.Error(), base.DOC_URL})
+		return
+	}
+	if !canAccessMigrationTask(ctx, task) {
+		ctx.HandleAPI(403, "Given migration task does not belong to you.")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"id":     task.Id,
+		"status": migrationTaskStatusString(task.Status),
+	}
+	if task.Status == models.MIGRATION_TASK_SUCCESS {
+		resp["repo_id"] = task.RepoId
+	}
+	if task.Status == models.MIGRATION_TASK_FAILED {
+		resp["error"] = task.Error
+	}
+	ctx.JSON(200, resp)
+}
+
+// StreamMigrateProgress serves GET /repos/migrate/:id/progress as a
+// Server-Sent Events stream of the raw git progress lines (objects
+// received, deltas resolved, percentage) emitted while the clone runs. The
+// stream closes once the task leaves the running state.
+func StreamMigrateProgress(ctx *middleware.Context) {
+	task, err := models.GetMigrationTaskById(ctx.ParamsInt64(":id"))
+	if err != nil {
+		ctx.Handle(404, "GetMigrationTaskById", err)
+		return
+	}
+	if !canAccessMigrationTask(ctx, task) {
+		ctx.Handle(403, "StreamMigrateProgress", fmt.Errorf("migration task does not belong to you"))
+		return
+	}
+
+	flusher, ok := ctx.Resp.(interface{ Flush() })
+	if !ok {
+		ctx.Handle(500, "StreamMigrateProgress", fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	ctx.Resp.Header().Set("Content-Type", "text/event-stream")
+	ctx.Resp.Header().Set("Cache-Control", "no-cache")
+	ctx.Resp.WriteHeader(200)
+
+	lines, unsubscribe := models.SubscribeMigrationProgress(task.Id)
+	defer unsubscribe()
+
+	for line := range lines {
+		if _, err := fmt.Fprintf(ctx.Resp, "data: %s\n\n", line); err != nil {
+			// Client went away mid-stream; stop writing and let the deferred
+			// unsubscribe drop us from the hub instead of leaking this
+			// goroutine's subscription forever.
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// CancelMigration serves DELETE /repos/migrate/:id and requests that a
+// running migration stop as soon as it next checks for cancellation.
+func CancelMigration(ctx *middleware.Context) {
+	task, err := models.GetMigrationTaskById(ctx.ParamsInt64(":id"))
+	if err != nil {
+		ctx.JSON(404, &base.ApiJsonErr{err.Error(), base.DOC_URL})
+		return
+	}
+	if !canAccessMigrationTask(ctx, task) {
+		ctx.HandleAPI(403, "Given migration task does not belong to you.")
+		return
+	}
+
+	if err := models.CancelMigrationTask(task.Id); err != nil {
+		ctx.JSON(422, &base.ApiJsonErr{err.Error(), base.DOC_URL})
+		return
+	}
+	ctx.WriteHeader(202)
+}
@@ -0,0 +1,248 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package v1
+
+import (
+	sdk "github.com/go-gitea/go-sdk"
+
+	"github.com/go-gitea/gitea/models"
+	"github.com/go-gitea/gitea/modules/base"
+	"github.com/go-gitea/gitea/modules/log"
+	"github.com/go-gitea/gitea/modules/middleware"
+)
+
+// ToApiPullRequest converts a pull request to the API format.
+func ToApiPullRequest(pr *models.PullRequest) *sdk.PullRequest {
+	state := "open"
+	if pr.Issue.IsClosed {
+		state = "closed"
+	}
+
+	apiPR := &sdk.PullRequest{
+		Id:         pr.Id,
+		Index:      pr.Issue.Index,
+		Poster:     *ToApiUser(pr.Issue.Poster),
+		Title:      pr.Issue.Name,
+		Body:       pr.Issue.Content,
+		State:      state,
+		Mergeable:  pr.Status == models.PULL_REQUEST_STATUS_MERGEABLE,
+		HasMerged:  pr.HasMerged,
+		HeadBranch: pr.HeadBranch,
+		BaseBranch: pr.BaseBranch,
+	}
+	if pr.HasMerged {
+		apiPR.MergedCommitId = pr.MergedCommitId
+	}
+	return apiPR
+}
+
+// ListPullRequests serves GET /repos/:owner/:repo/pulls.
+// https://developer.github.com/v3/pulls/#list-pull-requests
+func ListPullRequests(ctx *middleware.Context) {
+	state := ctx.Query("state")
+	if len(state) == 0 {
+		state = "open"
+	}
+
+	sortType := ctx.Query("sort")
+	switch sortType {
+	case "created":
+		sortType = "newest"
+	case "updated":
+		sortType = "recentupdate"
+	case "popularity":
+		sortType = "mostcomment"
+	default:
+		sortType = "newest"
+	}
+	if ctx.Query("direction") == "asc" {
+		sortType = "oldest"
+	}
+
+	prs, _, err := models.PullRequests(ctx.Repo.Repository.Id, &models.PullRequestsOptions{
+		Page:     ctx.QueryInt("page"),
+		State:    state,
+		SortType: sortType,
+	})
+	if err != nil {
+		ctx.JSON(500, &base.ApiJsonErr{"PullRequests: " + err.Error(), base.DOC_URL})
+		return
+	}
+
+	apiPRs := make([]*sdk.PullRequest, len(prs))
+	for i := range prs {
+		apiPRs[i] = ToApiPullRequest(prs[i])
+	}
+	ctx.JSON(200, &apiPRs)
+}
+
+// GetPullRequest serves GET /repos/:owner/:repo/pulls/:index.
+// https://developer.github.com/v3/pulls/#get-a-single-pull-request
+func GetPullRequest(ctx *middleware.Context) {
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, ctx.ParamsInt64(":index"))
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Error(404)
+		} else {
+			ctx.JSON(500, &base.ApiJsonErr{"GetPullRequestByIndex: " + err.Error(), base.DOC_URL})
+		}
+		return
+	}
+	ctx.JSON(200, ToApiPullRequest(pr))
+}
+
+// CreatePullRequest serves POST /repos/:owner/:repo/pulls.
+// https://developer.github.com/v3/pulls/#create-a-pull-request
+func CreatePullRequest(ctx *middleware.Context, opt sdk.CreatePullRequestOption) {
+	repo := ctx.Repo.Repository
+
+	// opt.Head follows GitHub's convention: a bare branch name refers to repo
+	// itself, while "owner:branch" raises the pull request from owner's
+	// fork of repo.
+	headRepo, headBranch, err := models.ResolveCompareHead(repo, opt.Head)
+	if err != nil {
+		ctx.JSON(422, &base.ApiJsonErr{"ResolveCompareHead: " + err.Error(), base.DOC_URL})
+		return
+	}
+
+	pull := &models.Issue{
+		RepoId:   repo.Id,
+		Index:    int64(repo.NumIssues) + 1,
+		Name:     opt.Title,
+		PosterId: ctx.User.Id,
+		Poster:   ctx.User,
+		IsPull:   true,
+		Content:  opt.Body,
+	}
+	pr := &models.PullRequest{
+		HeadRepoId: headRepo.Id,
+		HeadBranch: headBranch,
+		BaseRepoId: repo.Id,
+		BaseBranch: opt.Base,
+	}
+
+	if err := models.NewPullRequest(repo, pull, nil, nil, pr); err != nil {
+		ctx.JSON(500, &base.ApiJsonErr{"NewPullRequest: " + err.Error(), base.DOC_URL})
+		return
+	}
+
+	log.Trace("Pull request created via API: %d/%d", repo.Id, pull.Id)
+	ctx.JSON(201, ToApiPullRequest(pr))
+}
+
+// EditPullRequest serves PATCH /repos/:owner/:repo/pulls/:index. The only
+// edit currently supported is closing an open pull request without merging
+// it; other fields in opt are ignored.
+// https://developer.github.com/v3/pulls/#update-a-pull-request
+func EditPullRequest(ctx *middleware.Context, opt sdk.EditPullRequestOption) {
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, ctx.ParamsInt64(":index"))
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Error(404)
+		} else {
+			ctx.JSON(500, &base.ApiJsonErr{"GetPullRequestByIndex: " + err.Error(), base.DOC_URL})
+		}
+		return
+	}
+
+	if opt.State == "closed" && !pr.Issue.IsClosed {
+		if err = pr.ClosePullRequest(ctx.User); err != nil {
+			ctx.JSON(500, &base.ApiJsonErr{"ClosePullRequest: " + err.Error(), base.DOC_URL})
+			return
+		}
+	}
+
+	ctx.JSON(200, ToApiPullRequest(pr))
+}
+
+// MergePullRequest serves POST /repos/:owner/:repo/pulls/:index/merge.
+// https://developer.github.com/v3/pulls/#merge-a-pull-request-merge-button
+func MergePullRequest(ctx *middleware.Context, opt sdk.MergePullRequestOption) {
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, ctx.ParamsInt64(":index"))
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Error(404)
+		} else {
+			ctx.JSON(500, &base.ApiJsonErr{"GetPullRequestByIndex: " + err.Error(), base.DOC_URL})
+		}
+		return
+	}
+
+	style := models.MergeStyle(opt.MergeMethod)
+	if len(style) == 0 {
+		style = models.MERGE_STYLE_MERGE
+	}
+
+	// pr.Issue here only carries what GetPullRequestByIndex's GetIssueByIndex
+	// loaded, which doesn't include Repo; Merge backfills it from pr.BaseRepo
+	// itself before it's needed, so this call is safe without doing that here.
+	if err = pr.Merge(ctx.User, style); err != nil {
+		ctx.JSON(500, &base.ApiJsonErr{"Merge: " + err.Error(), base.DOC_URL})
+		return
+	}
+
+	ctx.JSON(200, map[string]interface{}{
+		"merged": true,
+		"sha":    pr.MergedCommitId,
+	})
+}
+
+// ListPullComments serves GET /repos/:owner/:repo/pulls/:index/comments.
+// https://developer.github.com/v3/pulls/comments/#list-comments-on-a-pull-request
+func ListPullComments(ctx *middleware.Context) {
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, ctx.ParamsInt64(":index"))
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Error(404)
+		} else {
+			ctx.JSON(500, &base.ApiJsonErr{"GetPullRequestByIndex: " + err.Error(), base.DOC_URL})
+		}
+		return
+	}
+
+	comments, err := models.GetCommentsByIssueId(pr.IssueId)
+	if err != nil {
+		ctx.JSON(500, &base.ApiJsonErr{"GetCommentsByIssueId: " + err.Error(), base.DOC_URL})
+		return
+	}
+
+	apiComments := make([]*sdk.PullRequestComment, len(comments))
+	for i := range comments {
+		apiComments[i] = &sdk.PullRequestComment{
+			Id:      comments[i].Id,
+			Poster:  *ToApiUser(comments[i].Poster),
+			Body:    comments[i].Content,
+			Created: comments[i].Created,
+		}
+	}
+	ctx.JSON(200, &apiComments)
+}
+
+// CreatePullComment serves POST /repos/:owner/:repo/pulls/:index/comments.
+// https://developer.github.com/v3/pulls/comments/#create-a-comment
+func CreatePullComment(ctx *middleware.Context, opt sdk.CreatePullReviewCommentOption) {
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, ctx.ParamsInt64(":index"))
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Error(404)
+		} else {
+			ctx.JSON(500, &base.ApiJsonErr{"GetPullRequestByIndex: " + err.Error(), base.DOC_URL})
+		}
+		return
+	}
+
+	comment, err := models.CreateComment(ctx.User, ctx.Repo.Repository, pr.Issue, opt.Body, "")
+	if err != nil {
+		ctx.JSON(500, &base.ApiJsonErr{"CreateComment: " + err.Error(), base.DOC_URL})
+		return
+	}
+
+	ctx.JSON(201, &sdk.PullRequestComment{
+		Id:      comment.Id,
+		Poster:  *ToApiUser(comment.Poster),
+		Body:    comment.Content,
+		Created: comment.Created,
+	})
+}
@@ -5,8 +5,10 @@
 package v1
 
 import (
+	"fmt"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/Unknwon/com"
@@ -66,8 +68,22 @@ func SearchRepos(ctx *middleware.Context) {
 			}
 			if u.IsOrganization() && u.IsOwnedBy(ctx.User.Id) {
 				opt.Private = true
+			} else {
+				// Not the owner and not an owning org member: allow private
+				// results only if the current user collaborates on at least
+				// one of u's repositories.
+				accessRepos, err := ctx.User.GetAccessibleRepositories()
+				if err != nil {
+					ctx.JSON(500, &base.ApiJsonErr{"GetAccessibleRepositories: " + err.Error(), base.DOC_URL})
+					return
+				}
+				for repo := range accessRepos {
+					if repo.OwnerId == opt.Uid {
+						opt.Private = true
+						break
+					}
+				}
 			}
-			// FIXME: how about collaborators?
 		}
 	}
 
@@ -198,76 +214,212 @@ func MigrateRepo(ctx *middleware.Context, form auth.MigrateRepoForm) {
 		}
 	}
 
-	// Remote address can be HTTP/HTTPS/Git URL or local path.
+	// Remote address can be HTTP/HTTPS/Git URL, an SSH remote, or a local path.
 	remoteAddr := form.CloneAddr
-	if strings.HasPrefix(form.CloneAddr, "http://") ||
+	var sshConfig *models.MigrateSSHConfig
+	switch {
+	case strings.HasPrefix(form.CloneAddr, "http://") ||
 		strings.HasPrefix(form.CloneAddr, "https://") ||
-		strings.HasPrefix(form.CloneAddr, "git://") {
-		u, err := url.Parse(form.CloneAddr)
+		strings.HasPrefix(form.CloneAddr, "git://"):
+		parsed, err := url.Parse(form.CloneAddr)
 		if err != nil {
 			ctx.HandleAPI(422, err)
 			return
 		}
 		if len(form.AuthUsername) > 0 || len(form.AuthPassword) > 0 {
-			u.User = url.UserPassword(form.AuthUsername, form.AuthPassword)
+			parsed.User = url.UserPassword(form.AuthUsername, form.AuthPassword)
+		}
+		remoteAddr = parsed.String()
+
+	case strings.HasPrefix(form.CloneAddr, "git@") || strings.HasPrefix(form.CloneAddr, "ssh://"):
+		if !form.UsesSSHAuth() {
+			ctx.HandleAPI(422, "SSH remotes require either auth_ssh_private_key or auth_ssh_key_id.")
+			return
+		}
+		privateKey := form.AuthSSHPrivateKey
+		if form.AuthSSHKeyId > 0 {
+			cred, err := models.GetMigrationCredentialById(form.AuthSSHKeyId)
+			if err != nil {
+				ctx.HandleAPI(422, err)
+				return
+			}
+			if cred.OwnerId != u.Id {
+				ctx.HandleAPI(403, "Given migration credential does not belong to you.")
+				return
+			}
+			privateKey = cred.PrivateKey
+		}
+		sshConfig = &models.MigrateSSHConfig{
+			PrivateKey:  privateKey,
+			Passphrase:  form.AuthSSHPassphrase,
+			Fingerprint: form.AuthSSHFingerprint,
 		}
-		remoteAddr = u.String()
-	} else if !com.IsDir(remoteAddr) {
+
+	case !com.IsDir(remoteAddr):
 		ctx.HandleAPI(422, "Invalid local path, it does not exist or not a directory.")
 		return
 	}
 
-	repo, err := models.MigrateRepository(ctxUser, form.RepoName, form.Description, form.Private, form.Mirror, remoteAddr)
+	task, err := models.EnqueueMigrationTask(u, models.MigrateOptions{
+		Owner:     ctxUser,
+		Name:      form.RepoName,
+		Desc:      form.Description,
+		Private:   form.Private,
+		Mirror:    form.Mirror,
+		CloneAddr: remoteAddr,
+		SSHConfig: sshConfig,
+	})
 	if err != nil {
-		if repo != nil {
-			if errDelete := models.DeleteRepository(ctxUser.Id, repo.Id, ctxUser.Name); errDelete != nil {
-				log.Error(4, "DeleteRepository: %v", errDelete)
-			}
-		}
 		ctx.HandleAPI(500, err)
 		return
 	}
 
-	log.Trace("Repository migrated: %s/%s", ctxUser.Name, form.RepoName)
-	ctx.WriteHeader(200)
+	log.Trace("Repository migration queued: %s/%s (task %d)", ctxUser.Name, form.RepoName, task.Id)
+	ctx.JSON(202, map[string]interface{}{
+		"id":     task.Id,
+		"status": "queued",
+	})
+}
+
+// repoWithPerm pairs a repository with the API permission bits computed for
+// the requesting user.
+type repoWithPerm struct {
+	repo *models.Repository
+	perm sdk.Permission
 }
 
-// GET /user/repos
+// lessRepoWithPerm reports whether a should sort before b for the given
+// sort key and direction. Each case branches on ascending explicitly rather
+// than relying on a single "ascending flips less" trick, since that trick
+// only holds for the time-based keys: for full_name, flipping the operator
+// themselves is what ascending/descending actually mean.
+func lessRepoWithPerm(a, b repoWithPerm, sortType string, ascending bool) bool {
+	switch sortType {
+	case "updated", "pushed":
+		if ascending {
+			return a.repo.Updated.Before(b.repo.Updated)
+		}
+		return a.repo.Updated.After(b.repo.Updated)
+	case "full_name":
+		if ascending {
+			return a.repo.Name < b.repo.Name
+		}
+		return a.repo.Name > b.repo.Name
+	default: // "created"
+		if ascending {
+			return a.repo.Created.Before(b.repo.Created)
+		}
+		return a.repo.Created.After(b.repo.Created)
+	}
+}
+
+// ListMyRepos serves GET /user/repos.
 // https://developer.github.com/v3/repos/#list-your-repositories
+//
+// Accepts the GitHub-style query params type=(all|owner|public|private|member),
+// sort=(created|updated|pushed|full_name), direction=(asc|desc), and
+// page/per_page, and returns a Link header for pagination.
 func ListMyRepos(ctx *middleware.Context) {
-	ownRepos, err := models.GetRepositories(ctx.User.Id, true)
-	if err != nil {
-		ctx.JSON(500, &base.ApiJsonErr{"GetRepositories: " + err.Error(), base.DOC_URL})
-		return
+	listType := ctx.Query("type")
+	if len(listType) == 0 {
+		listType = "all"
 	}
-	numOwnRepos := len(ownRepos)
 
-	accessibleRepos, err := ctx.User.GetAccessibleRepositories()
-	if err != nil {
-		ctx.JSON(500, &base.ApiJsonErr{"GetAccessibleRepositories: " + err.Error(), base.DOC_URL})
-		return
-	}
+	seen := make(map[int64]bool)
+	var withPerm []repoWithPerm
+
+	includeOwner := listType == "all" || listType == "owner" || listType == "public" || listType == "private"
+	includeMember := listType == "all" || listType == "member" || listType == "public" || listType == "private"
 
-	repos := make([]*sdk.Repository, numOwnRepos+len(accessibleRepos))
-	for i := range ownRepos {
-		repos[i] = ToApiRepository(ctx.User, ownRepos[i], sdk.Permission{true, true, true})
+	if includeOwner {
+		ownRepos, err := models.GetRepositories(ctx.User.Id, true)
+		if err != nil {
+			ctx.JSON(500, &base.ApiJsonErr{"GetRepositories: " + err.Error(), base.DOC_URL})
+			return
+		}
+		for _, repo := range ownRepos {
+			seen[repo.Id] = true
+			withPerm = append(withPerm, repoWithPerm{repo, sdk.Permission{true, true, true}})
+		}
 	}
-	i := numOwnRepos
 
-	for repo, access := range accessibleRepos {
-		if err = repo.GetOwner(); err != nil {
-			ctx.JSON(500, &base.ApiJsonErr{"GetOwner: " + err.Error(), base.DOC_URL})
+	if includeMember {
+		accessibleRepos, err := ctx.User.GetAccessibleRepositories()
+		if err != nil {
+			ctx.JSON(500, &base.ApiJsonErr{"GetAccessibleRepositories: " + err.Error(), base.DOC_URL})
 			return
 		}
 
-		repos[i] = ToApiRepository(repo.Owner, repo, sdk.Permission{false, access >= models.ACCESS_MODE_WRITE, true})
+		for repo, access := range accessibleRepos {
+			if seen[repo.Id] {
+				continue
+			}
+			seen[repo.Id] = true
+
+			if err = repo.GetOwner(); err != nil {
+				ctx.JSON(500, &base.ApiJsonErr{"GetOwner: " + err.Error(), base.DOC_URL})
+				return
+			}
+
+			perm := sdk.Permission{false, access >= models.ACCESS_MODE_WRITE, true}
+			if repo.Owner.IsOrganization() && repo.Owner.IsOwnedBy(ctx.User.Id) {
+				perm.Admin = true
+			}
+			withPerm = append(withPerm, repoWithPerm{repo, perm})
+		}
+	}
+
+	if listType == "public" || listType == "private" {
+		wantPrivate := listType == "private"
+		filtered := withPerm[:0]
+		for _, rp := range withPerm {
+			if rp.repo.IsPrivate == wantPrivate {
+				filtered = append(filtered, rp)
+			}
+		}
+		withPerm = filtered
+	}
+
+	sortType := ctx.Query("sort")
+	ascending := ctx.Query("direction") == "asc"
+	sort.Slice(withPerm, func(i, j int) bool {
+		return lessRepoWithPerm(withPerm[i], withPerm[j], sortType, ascending)
+	})
 
-		// FIXME: cache result to reduce DB query?
-		if repo.Owner.IsOrganization() && repo.Owner.IsOwnedBy(ctx.User.Id) {
-			repos[i].Permissions.Admin = true
+	page := ctx.QueryInt("page")
+	if page <= 0 {
+		page = 1
+	}
+	perPage := ctx.QueryInt("per_page")
+	if perPage <= 0 {
+		perPage = 30
+	}
+
+	total := len(withPerm)
+	start := (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+	pageRepos := withPerm[start:end]
+
+	repos := make([]*sdk.Repository, len(pageRepos))
+	for i, rp := range pageRepos {
+		if rp.repo.Owner == nil {
+			if err := rp.repo.GetOwner(); err != nil {
+				ctx.JSON(500, &base.ApiJsonErr{"GetOwner: " + err.Error(), base.DOC_URL})
+				return
+			}
 		}
-		i++
+		repos[i] = ToApiRepository(rp.repo.Owner, rp.repo, rp.perm)
 	}
 
+	if end < total {
+		ctx.Resp.Header().Set("Link", fmt.Sprintf(`<%s?page=%d&per_page=%d>; rel="next"`,
+			ctx.Req.URL.Path, page+1, perPage))
+	}
 	ctx.JSON(200, &repos)
 }
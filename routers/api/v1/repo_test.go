@@ -0,0 +1,51 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-gitea/gitea/models"
+)
+
+func TestLessRepoWithPermFullName(t *testing.T) {
+	alpha := repoWithPerm{repo: &models.Repository{Name: "alpha"}}
+	beta := repoWithPerm{repo: &models.Repository{Name: "beta"}}
+
+	if !lessRepoWithPerm(alpha, beta, "full_name", true) {
+		t.Errorf("expected alpha before beta ascending")
+	}
+	if lessRepoWithPerm(alpha, beta, "full_name", false) {
+		t.Errorf("expected alpha not before beta descending")
+	}
+	if !lessRepoWithPerm(beta, alpha, "full_name", false) {
+		t.Errorf("expected beta before alpha descending")
+	}
+}
+
+func TestLessRepoWithPermCreated(t *testing.T) {
+	older := repoWithPerm{repo: &models.Repository{Created: time.Unix(1000, 0)}}
+	newer := repoWithPerm{repo: &models.Repository{Created: time.Unix(2000, 0)}}
+
+	if !lessRepoWithPerm(newer, older, "created", false) {
+		t.Errorf("expected newer before older by default (descending)")
+	}
+	if !lessRepoWithPerm(older, newer, "created", true) {
+		t.Errorf("expected older before newer ascending")
+	}
+}
+
+func TestLessRepoWithPermUpdated(t *testing.T) {
+	stale := repoWithPerm{repo: &models.Repository{Updated: time.Unix(1000, 0)}}
+	fresh := repoWithPerm{repo: &models.Repository{Updated: time.Unix(2000, 0)}}
+
+	if !lessRepoWithPerm(fresh, stale, "updated", false) {
+		t.Errorf("expected more recently updated repo first by default (descending)")
+	}
+	if !lessRepoWithPerm(stale, fresh, "pushed", true) {
+		t.Errorf("expected stale before fresh ascending for sort=pushed")
+	}
+}
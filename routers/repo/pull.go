@@ -5,15 +5,175 @@
 package repo
 
 import (
+	"github.com/Unknwon/com"
+
+	"github.com/go-gitea/gitea/models"
+	"github.com/go-gitea/gitea/modules/auth"
 	"github.com/go-gitea/gitea/modules/base"
+	"github.com/go-gitea/gitea/modules/log"
 	"github.com/go-gitea/gitea/modules/middleware"
 )
 
 const (
-	PULLS base.TplName = "repo/pulls"
+	PULLS     base.TplName = "repo/pulls"
+	PULL_VIEW base.TplName = "repo/pull/view"
+	PULL_NEW  base.TplName = "repo/pull/new"
 )
 
+// Pulls renders the list of pull requests for a repository, paginated by
+// state and sorted according to the "sort" query parameter.
 func Pulls(ctx *middleware.Context) {
+	ctx.Data["Title"] = ctx.Tr("repo.pulls")
 	ctx.Data["IsRepoToolbarPulls"] = true
+
+	state := ctx.Query("state")
+	if len(state) == 0 {
+		state = "open"
+	}
+	ctx.Data["State"] = state
+
+	sortType := ctx.Query("sort")
+	if len(sortType) == 0 {
+		sortType = "newest"
+	}
+	ctx.Data["SortType"] = sortType
+
+	page := ctx.QueryInt("page")
+	if page <= 0 {
+		page = 1
+	}
+
+	prs, count, err := models.PullRequests(ctx.Repo.Repository.Id, &models.PullRequestsOptions{
+		Page:     page,
+		State:    state,
+		SortType: sortType,
+	})
+	if err != nil {
+		ctx.Handle(500, "PullRequests", err)
+		return
+	}
+
+	ctx.Data["PullRequests"] = prs
+	ctx.Data["Page"] = page
+	ctx.Data["Total"] = count
 	ctx.HTML(200, PULLS)
 }
+
+// CompareAndPullRequest renders the new pull request form, which compares
+// the current branch against the repository's default branch.
+func CompareAndPullRequest(ctx *middleware.Context) {
+	ctx.Data["Title"] = ctx.Tr("repo.pulls.compare_changes")
+	ctx.Data["IsRepoToolbarPulls"] = true
+	ctx.Data["BaseBranch"] = ctx.Repo.Repository.DefaultBranch
+	ctx.Data["HeadBranch"] = ctx.Repo.BranchName
+	ctx.HTML(200, PULL_NEW)
+}
+
+// CompareAndPullRequestPost handles submission of the new pull request form.
+func CompareAndPullRequestPost(ctx *middleware.Context, form auth.CreateIssueForm) {
+	repo := ctx.Repo.Repository
+
+	headRepo, headBranch, err := models.ResolveCompareHead(repo, form.HeadBranch)
+	if err != nil {
+		ctx.Handle(422, "ResolveCompareHead", err)
+		return
+	}
+
+	pull := &models.Issue{
+		RepoId:   repo.Id,
+		Index:    int64(repo.NumIssues) + 1,
+		Name:     form.IssueName,
+		PosterId: ctx.User.Id,
+		Poster:   ctx.User,
+		IsPull:   true,
+		Content:  form.Content,
+	}
+	pr := &models.PullRequest{
+		HeadRepoId: headRepo.Id,
+		HeadBranch: headBranch,
+		BaseRepoId: repo.Id,
+		BaseBranch: form.BaseBranch,
+	}
+
+	if err := models.NewPullRequest(repo, pull, nil, nil, pr); err != nil {
+		ctx.Handle(500, "NewPullRequest", err)
+		return
+	}
+
+	log.Trace("Pull request created: %d/%d", repo.Id, pull.Id)
+	ctx.Redirect(ctx.Repo.RepoLink + "/pulls/" + com.ToStr(pull.Index))
+}
+
+// ViewPull renders a single pull request's conversation, including its
+// merge status and the shared issue comment thread.
+func ViewPull(ctx *middleware.Context) {
+	index := ctx.ParamsInt64(":index")
+
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, index)
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Handle(404, "GetPullRequestByIndex", err)
+		} else {
+			ctx.Handle(500, "GetPullRequestByIndex", err)
+		}
+		return
+	}
+
+	ctx.Data["Title"] = pr.Issue.Name
+	ctx.Data["IsRepoToolbarPulls"] = true
+	ctx.Data["PullRequest"] = pr
+	ctx.Data["Issue"] = pr.Issue
+	ctx.HTML(200, PULL_VIEW)
+}
+
+// ClosePullRequest closes a pull request without merging it.
+func ClosePullRequest(ctx *middleware.Context) {
+	index := ctx.ParamsInt64(":index")
+
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, index)
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Handle(404, "GetPullRequestByIndex", err)
+		} else {
+			ctx.Handle(500, "GetPullRequestByIndex", err)
+		}
+		return
+	}
+
+	if err = pr.ClosePullRequest(ctx.User); err != nil {
+		ctx.Handle(500, "ClosePullRequest", err)
+		return
+	}
+
+	log.Trace("Pull request #%d closed by %s", index, ctx.User.Name)
+	ctx.Redirect(ctx.Repo.RepoLink + "/pulls/" + com.ToStr(index))
+}
+
+// MergePullRequest merges a pull request using the strategy requested in
+// the "do" form value ("merge", "rebase" or "squash").
+func MergePullRequest(ctx *middleware.Context) {
+	index := ctx.ParamsInt64(":index")
+
+	pr, err := models.GetPullRequestByIndex(ctx.Repo.Repository.Id, index)
+	if err != nil {
+		if models.IsErrPullRequestNotExist(err) {
+			ctx.Handle(404, "GetPullRequestByIndex", err)
+		} else {
+			ctx.Handle(500, "GetPullRequestByIndex", err)
+		}
+		return
+	}
+
+	style := models.MergeStyle(ctx.Query("do"))
+	if len(style) == 0 {
+		style = models.MERGE_STYLE_MERGE
+	}
+
+	if err = pr.Merge(ctx.User, style); err != nil {
+		ctx.Handle(500, "Merge", err)
+		return
+	}
+
+	log.Trace("Pull request #%d merged by %s", index, ctx.User.Name)
+	ctx.Redirect(ctx.Repo.RepoLink + "/pulls/" + com.ToStr(index))
+}